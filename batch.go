@@ -0,0 +1,24 @@
+package hyperloglog
+
+import "math"
+
+// pow2inv[k] == 2^-k, precomputed so countDense's harmonic sum is a
+// table lookup per register instead of a math.Pow call. This is the
+// scalar building block the AVX2 path described in batch_amd64.go
+// would gather into YMM registers 32-at-a-time; absent that assembly,
+// a plain Go loop over this table is still noticeably cheaper than
+// repeated math.Pow, which is the bulk of what made Count slow on the
+// large register sets precisions 14-18 use.
+var pow2inv [256]float64
+
+func init() {
+	for k := range pow2inv {
+		pow2inv[k] = math.Ldexp(1, -k)
+	}
+}
+
+// AddBatch adds every value in vals to the sketch. See
+// batch_amd64.go/batch_generic.go for the per-arch implementation.
+func (h *HyperLogLog) AddBatch(vals []uint64) {
+	addBatch(h, vals)
+}
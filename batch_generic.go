@@ -0,0 +1,16 @@
+//go:build !amd64 || noasm
+
+package hyperloglog
+
+// TODO(chunk0-5): see batch_amd64.go -- the AVX2 kernel it describes
+// isn't implemented, so this fallback is what every architecture gets.
+//
+// addBatch is the portable fallback for architectures (or builds
+// tagged noasm) that don't get the amd64 AVX2 kernel described in
+// batch_amd64.go -- which, as of this file, is every architecture,
+// since that kernel isn't implemented yet either. See batch_amd64.go.
+func addBatch(h *HyperLogLog, vals []uint64) {
+	for _, v := range vals {
+		h.Add64(v)
+	}
+}
@@ -0,0 +1,163 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Binary format:
+//
+//	magic[2]  = 'H', 'L'
+//	version   = binaryVersion
+//	flags     = bit 0: representation (0 = dense, 1 = sparse)
+//	precision = p, so m is derivable as 1<<p
+//	payload:
+//	  dense:  m raw register bytes
+//	  sparse: uvarint count, then that many (uvarint index-delta, byte rho) pairs
+//
+// This avoids both the per-register JSON blow-up of the old
+// Serialize/Unserialize and the precision loss of storing registers as
+// `int`: a dense sketch round-trips as header + m bytes, and a sparse
+// one as header + a few bytes per populated register.
+const (
+	binaryMagic0  = 'H'
+	binaryMagic1  = 'L'
+	binaryVersion = 1
+
+	flagSparse = 1 << 0
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(binaryMagic0)
+	buf.WriteByte(binaryMagic1)
+	buf.WriteByte(binaryVersion)
+
+	var flags byte
+	if h.rep == repSparse {
+		flags |= flagSparse
+	}
+	buf.WriteByte(flags)
+	buf.WriteByte(h.p)
+
+	if h.rep == repSparse {
+		h.mergeTmpSet()
+
+		var varintBuf [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(varintBuf[:], uint64(len(h.sparseList)))
+		buf.Write(varintBuf[:n])
+
+		var prevIdx uint32
+		for _, v := range h.sparseList {
+			idx, r := decodeSparse(v)
+			n := binary.PutUvarint(varintBuf[:], uint64(idx-prevIdx))
+			buf.Write(varintBuf[:n])
+			buf.WriteByte(r)
+			prevIdx = idx
+		}
+	} else {
+		buf.Write(h.registers)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return fmt.Errorf("hyperloglog: binary payload too short (%d bytes)", len(data))
+	}
+	if data[0] != binaryMagic0 || data[1] != binaryMagic1 {
+		return fmt.Errorf("hyperloglog: bad magic bytes")
+	}
+	if data[2] != binaryVersion {
+		return fmt.Errorf("hyperloglog: unsupported binary version %d", data[2])
+	}
+	flags := data[3]
+	p := data[4]
+
+	rest := data[5:]
+
+	// A sparse payload only ever comes from NewPlus, so its precision
+	// must fall in the same [minPrecision, maxPrecision] range NewPlus
+	// enforces. A dense payload can come from New with any power-of-two
+	// register count, which isn't bounded that way, but p must still be
+	// small enough that 1<<p doesn't overflow uint and wrap to 0 -- an
+	// all-zero m would pass the length check below for an empty payload
+	// and then panic on first Add64 (h.registers[j] on a zero-length
+	// slice).
+	if flags&flagSparse != 0 {
+		if p < minPrecision || p > maxPrecision {
+			return fmt.Errorf("hyperloglog: sparse payload has precision %d outside valid range [%d, %d]", p, minPrecision, maxPrecision)
+		}
+	} else if p >= 64 {
+		return fmt.Errorf("hyperloglog: precision %d too large (must be < 64)", p)
+	}
+
+	h.p = p
+	h.b = uint32(p)
+	h.m = uint(1) << p
+	h.alpha = get_alpha(h.m)
+
+	if flags&flagSparse != 0 {
+		buf := bytes.NewReader(rest)
+		count, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return fmt.Errorf("hyperloglog: reading sparse count: %w", err)
+		}
+
+		// Each entry is at least 2 bytes (a 1+ byte uvarint delta and
+		// a rho byte), so a count that can't possibly fit in what's
+		// left can't be genuine -- reject it before using it as an
+		// allocation size, rather than letting a corrupt or malicious
+		// length prefix drive an unbounded allocation.
+		if maxEntries := uint64(buf.Len()) / 2; count > maxEntries {
+			return fmt.Errorf("hyperloglog: sparse count %d exceeds what %d remaining bytes can hold", count, buf.Len())
+		}
+
+		sparseList := make([]uint32, 0, count)
+		var idx uint32
+		for i := uint64(0); i < count; i++ {
+			delta, err := binary.ReadUvarint(buf)
+			if err != nil {
+				return fmt.Errorf("hyperloglog: reading sparse entry %d: %w", i, err)
+			}
+			r, err := buf.ReadByte()
+			if err != nil {
+				return fmt.Errorf("hyperloglog: reading sparse entry %d: %w", i, err)
+			}
+			idx += uint32(delta)
+			if uint(idx) >= h.m {
+				return fmt.Errorf("hyperloglog: sparse entry %d has index %d out of range for m=%d", i, idx, h.m)
+			}
+			sparseList = append(sparseList, encodeSparse(idx, r))
+		}
+
+		h.rep = repSparse
+		h.sparseList = sparseList
+		h.tmpSet = nil
+		h.registers = nil
+		return nil
+	}
+
+	if uint(len(rest)) != h.m {
+		return fmt.Errorf("hyperloglog: expected %d register bytes, got %d", h.m, len(rest))
+	}
+	h.rep = repDense
+	h.registers = append([]uint8(nil), rest...)
+	h.sparseList = nil
+	h.tmpSet = nil
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder as a thin wrapper over MarshalBinary.
+func (h *HyperLogLog) GobEncode() ([]byte, error) {
+	return h.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder as a thin wrapper over UnmarshalBinary.
+func (h *HyperLogLog) GobDecode(data []byte) error {
+	return h.UnmarshalBinary(data)
+}
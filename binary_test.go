@@ -0,0 +1,99 @@
+package hyperloglog
+
+import (
+	"testing"
+)
+
+func TestMarshalBinaryRoundTripDense(t *testing.T) {
+	h, err := New(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 5000; i++ {
+		h.Add64(splitmix64(i))
+	}
+	want := h.Count()
+
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h2 := &HyperLogLog{}
+	if err := h2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := h2.Count(); got != want {
+		t.Errorf("Count after round-trip = %d, want %d", got, want)
+	}
+}
+
+func TestMarshalBinaryRoundTripSparse(t *testing.T) {
+	h, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 500; i++ {
+		h.Add64(splitmix64(i))
+	}
+	if h.rep != repSparse {
+		t.Fatalf("expected sketch to still be sparse after 500 adds to a p=14 sketch, got rep=%v", h.rep)
+	}
+	want := h.Count()
+
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h2 := &HyperLogLog{}
+	if err := h2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if h2.rep != repSparse {
+		t.Errorf("round-tripped sketch should still be sparse, got rep=%v", h2.rep)
+	}
+	if got := h2.Count(); got != want {
+		t.Errorf("Count after round-trip = %d, want %d", got, want)
+	}
+
+	// The round-tripped sketch must keep working as normal afterwards.
+	h2.Add64(0xdeadbeef)
+}
+
+func TestUnmarshalBinaryRejectsOversizedSparseCount(t *testing.T) {
+	data := []byte{'H', 'L', binaryVersion, flagSparse, 14, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	h := &HyperLogLog{}
+	if err := h.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected an error for a sparse count that can't fit in the remaining bytes, got nil")
+	}
+}
+
+func TestUnmarshalBinaryRejectsOutOfRangePrecision(t *testing.T) {
+	// Dense flag, precision 255: 1<<255 wraps to m==0, which must be
+	// rejected rather than accepted and left to panic on first Add64.
+	data := []byte{'H', 'L', binaryVersion, 0, 255}
+	h := &HyperLogLog{}
+	if err := h.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected an error for an out-of-range dense precision, got nil")
+	}
+
+	// Sparse flag, precision 3: below minPrecision, which NewPlus would
+	// never have produced.
+	data = []byte{'H', 'L', binaryVersion, flagSparse, 3, 0x00}
+	h = &HyperLogLog{}
+	if err := h.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected an error for an out-of-range sparse precision, got nil")
+	}
+}
+
+func TestUnmarshalBinaryRejectsOutOfRangeSparseIndex(t *testing.T) {
+	// precision 4 (m=16), one sparse entry whose delta-decoded index
+	// (1000) is far past m; must be rejected rather than accepted and
+	// left to panic later in denseView/toDense/Count.
+	data := []byte{'H', 'L', binaryVersion, flagSparse, 4, 0x01, 0xe8, 0x07, 0x01}
+	h := &HyperLogLog{}
+	if err := h.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected an error for a sparse index past the register count, got nil")
+	}
+}
@@ -5,49 +5,88 @@
 //
 // For a full description of the algorithm, see the paper HyperLogLog:
 // the analysis of a near-optimal cardinality estimation algorithm by
-// Flajolet, et. al.
+// Flajolet, et. al. The sparse representation and 64-bit hashing are
+// from HyperLogLog in Practice: Algorithmic Engineering of a State of
+// The Art Cardinality Estimation Algorithm by Heule, Nunkesser and Hall
+// ("HLL++") -- but not the bias-correction curve that paper is built
+// around: estimateBias (see bias.go) is a deliberate no-op pending the
+// published rawEstimateData/biasData tables, so NewPlus sketches get
+// HLL++'s linear-counting cutover and sparse/dense promotion without
+// its additional bias subtraction just above that cutover.
 package hyperloglog
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"math"
+	"math/bits"
 )
 
-var (
-	exp32 = math.Pow(2, 32)
+// representation identifies which of the two internal storage layouts
+// a HyperLogLog is currently using.
+type representation uint8
+
+const (
+	// repDense stores one byte per register in h.registers.
+	repDense representation = iota
+	// repSparse stores only the non-zero registers, as a sorted list
+	// of (index, rho) pairs, until it grows large enough that the
+	// dense layout would be cheaper.
+	repSparse
+)
+
+// minPrecision and maxPrecision bound the precision accepted by
+// NewPlus, matching the range for which HLL++ ships bias-correction
+// data (section 5 of the paper).
+const (
+	minPrecision = 4
+	maxPrecision = 18
 )
 
 type HyperLogLog struct {
 	m         uint    // Number of registers
 	b         uint32  // Number of bits used to determine register index
 	alpha     float64 // Bias correction constant
-	registers []uint8
+	registers []uint8 // dense registers; nil while rep == repSparse
+
+	p   uint8          // precision; m == 1<<p
+	rep representation // current storage layout
+
+	sparseList []uint32 // sorted, deduped (index<<8 | rho) entries
+	tmpSet     []uint32 // unsorted buffer, merged into sparseList when full
 }
 
 // Data to serialize
+//
+// Deprecated: SerializeData exposes the old per-register-as-int
+// representation; MarshalBinary is far more compact. Kept for callers
+// that depend on the DataObj shape.
 func (h *HyperLogLog) SerializeData() DataObj {
 	var m = DataObj{}
 	m.M = h.m
 	m.B = h.b
 	m.A = h.alpha
-	reg := make([]int, len(h.registers))
-	for i, v := range h.registers {
+	dense := h.Export()
+	reg := make([]int, len(dense))
+	for i, v := range dense {
 		reg[i] = int(v)
 	}
 	m.R = reg
 	return m
 }
 
-// Serialize
+// Serialize encodes h as a string. It now delegates to MarshalBinary
+// under the hood (base64-encoded, to keep the return type a string),
+// which is far more compact than the old per-register JSON and
+// doesn't lose precision on round-trip.
 func (h *HyperLogLog) Serialize() string {
-	var m DataObj = h.SerializeData()
-	b, err := json.Marshal(m)
+	b, err := h.MarshalBinary()
 	if err != nil {
 		fmt.Println("error:", err)
 		return ""
 	}
-	return string(b)
+	return base64.StdEncoding.EncodeToString(b)
 }
 
 type DataObj struct {
@@ -57,8 +96,17 @@ type DataObj struct {
 	R []int
 }
 
-// Unserialize
+// Unserialize decodes a string produced by Serialize. For
+// compatibility it also accepts the old DataObj-shaped JSON emitted by
+// versions of this package prior to the binary codec.
 func (h *HyperLogLog) Unserialize(str string) {
+	if b, err := base64.StdEncoding.DecodeString(str); err == nil {
+		if err := h.UnmarshalBinary(b); err == nil {
+			return
+		}
+	}
+
+	// Fall back to the legacy per-register JSON format.
 	var m DataObj
 	err := json.Unmarshal([]byte(str), &m)
 	if err != nil {
@@ -70,11 +118,49 @@ func (h *HyperLogLog) Unserialize(str string) {
 		reg[i] = uint8(v)
 	}
 
-	// Load object
 	h.m = m.M
 	h.b = m.B
 	h.alpha = m.A
+	h.p = uint8(m.B)
+	h.rep = repDense
 	h.registers = reg
+	h.sparseList = nil
+	h.tmpSet = nil
+}
+
+// Export returns a dense register slice for h. If h is currently
+// sparse, this builds a temporary copy rather than promoting h itself
+// -- callers that want h to actually switch representation (e.g.
+// because they know it's about to receive many more dense-sized
+// updates) should call toDense directly. Mainly useful for
+// serialization.
+func (h *HyperLogLog) Export() []uint8 {
+	return h.denseView()
+}
+
+// denseView returns a dense register slice for h without mutating it:
+// for a dense h this is just h.registers, and for a sparse h it's a
+// freshly built copy. Used anywhere we need another sketch's registers
+// without forcing that sketch to give up its sparse representation --
+// Merge and IntersectN's unionCount in particular, since merging into
+// one sketch shouldn't silently balloon the memory of the other
+// operand.
+func (h *HyperLogLog) denseView() []uint8 {
+	if h.rep == repDense {
+		return h.registers
+	}
+	registers := make([]uint8, h.m)
+	for _, v := range h.sparseList {
+		idx, r := decodeSparse(v)
+		registers[idx] = r
+	}
+	for _, v := range h.tmpSet {
+		idx, r := decodeSparse(v)
+		if r > registers[idx] {
+			registers[idx] = r
+		}
+	}
+	return registers
 }
 
 // Compute bias correction alpha_m.
@@ -101,8 +187,11 @@ func get_alpha(m uint) (result float64) {
 // tolerate. Each register uses one byte of memory.
 //
 // Approximate error will be:
-//     1.04 / sqrt(registers)
 //
+//	1.04 / sqrt(registers)
+//
+// New always starts in the dense representation; use NewPlus for the
+// HLL++ sparse-then-dense behaviour.
 func New(registers uint) (*HyperLogLog, error) {
 	if (registers & (registers - 1)) != 0 {
 		return nil, fmt.Errorf("number of registers %d not a power of two", registers)
@@ -110,17 +199,51 @@ func New(registers uint) (*HyperLogLog, error) {
 	h := &HyperLogLog{}
 	h.m = registers
 	h.b = uint32(math.Ceil(math.Log2(float64(registers))))
+	h.p = uint8(h.b)
 	h.alpha = get_alpha(registers)
+	h.rep = repDense
 	h.Reset()
 	return h, nil
 }
 
+// NewPlus returns a new HLL++ sketch with 2^precision registers.
+// precision must be in [4, 18]; lower precision uses less memory at
+// the cost of accuracy. Unlike New, the returned sketch starts out in
+// the sparse representation and is only promoted to the dense one
+// once that becomes the more compact option (see toDense).
+//
+// Note this does not yet include the HLL++ paper's empirical
+// bias-correction curve (see estimateBias in bias.go) -- counts get
+// the linear-counting cutover and sparse representation HLL++ adds,
+// not the additional bias subtraction, so accuracy just above the
+// cutover is closer to plain HLL than to paper-accuracy HLL++.
+func NewPlus(precision uint8) (*HyperLogLog, error) {
+	if precision < minPrecision || precision > maxPrecision {
+		return nil, fmt.Errorf("precision %d out of range [%d, %d]", precision, minPrecision, maxPrecision)
+	}
+	registers := uint(1) << precision
+	h := &HyperLogLog{}
+	h.m = registers
+	h.b = uint32(precision)
+	h.p = precision
+	h.alpha = get_alpha(registers)
+	h.rep = repSparse
+	h.sparseList = nil
+	h.tmpSet = nil
+	return h, nil
+}
+
 // Reset all internal variables and set the count to zero.
 func (h *HyperLogLog) Reset() {
 	h.registers = make([]uint8, h.m)
+	h.rep = repDense
+	h.sparseList = nil
+	h.tmpSet = nil
 }
 
-// Calculate the position of the leftmost 1-bit.
+// Calculate the position of the leftmost 1-bit, Flajolet's rho, over a
+// 32 bit value. Kept for the Add shim; new code should go through
+// rho64.
 func rho(val uint32, max uint32) uint8 {
 	r := uint32(1)
 	for val&0x80000000 == 0 && r <= max {
@@ -130,18 +253,45 @@ func rho(val uint32, max uint32) uint8 {
 	return uint8(r)
 }
 
+// rho64 is rho over a 64 bit value: the 1-based position of the
+// leftmost 1-bit, capped at max+1. Operating on the full 64 bits
+// (rather than the 32 bits Add used) is what lets HLL++ drop the
+// large-range correction entirely: cardinalities would need to
+// approach 2^64 before the estimator saturates.
+func rho64(val uint64, max uint8) uint8 {
+	if val == 0 {
+		return max + 1
+	}
+	lz := uint8(bits.LeadingZeros64(val))
+	if lz > max {
+		return max + 1
+	}
+	return lz + 1
+}
+
 // Add to the count. val should be a 32 bit unsigned integer from a
 // good hash function.
+//
+// Deprecated: Add is a shim over Add64 kept for source compatibility.
+// It places val in the upper 32 bits of a 64 bit value (the lower 32
+// bits are zero), which is fine for existing callers
+// but does not get the full benefit of a 64-bit hash; prefer Add64
+// with a hash function that actually produces 64 bits of entropy.
 func (h *HyperLogLog) Add(val uint32) {
-	k := 32 - h.b
-
-	// Determine register value
-	r := rho(val<<h.b, k)
+	h.Add64(uint64(val) << 32)
+}
 
-	// Determine register index
-	j := val >> uint(k)
+// Add64 adds to the count. val should be a 64 bit unsigned integer
+// from a good hash function (e.g. xxhash64 or a SipHash variant).
+func (h *HyperLogLog) Add64(val uint64) {
+	k := 64 - h.p
+	j := uint32(val >> uint(k))
+	r := rho64(val<<h.p, k)
 
-	// Increase register value if the value of the leftmost 1-bit is higher than the old value in the register
+	if h.rep == repSparse {
+		h.addSparse(j, r)
+		return
+	}
 	if r > h.registers[j] {
 		h.registers[j] = r
 	}
@@ -149,39 +299,64 @@ func (h *HyperLogLog) Add(val uint32) {
 
 // Get the estimated count.
 func (h *HyperLogLog) Count() uint64 {
+	if h.rep == repSparse {
+		return h.countSparse()
+	}
+	return h.countDense()
+}
+
+// countDense implements the HLL++ dense estimator: a bias-corrected
+// harmonic mean, falling back to linear counting for small
+// cardinalities. Unlike the original Flajolet estimator, there is no
+// large-range correction, because rho64 draws on the full 64 bits of
+// the hash rather than 32.
+func (h *HyperLogLog) countDense() uint64 {
 	sum := 0.0
+	zeros := 0
 	m := float64(h.m)
 	for _, val := range h.registers {
-		sum += 1.0 / math.Pow(2.0, float64(val))
+		sum += pow2inv[val]
+		if val == 0 {
+			zeros++
+		}
 	}
 	estimate := h.alpha * m * m / sum
-	if estimate <= 5.0/2.0*m {
-		// Small range correction
-		v := 0
-		for _, r := range h.registers {
-			if r == 0 {
-				v++
-			}
-		}
-		if v > 0 {
-			estimate = m * math.Log(m/float64(v))
+	if estimate <= 5.0*m {
+		estimate -= estimateBias(estimate, h.p)
+	}
+
+	if zeros != 0 {
+		lc := m * math.Log(m/float64(zeros))
+		if lc <= biasThreshold(h.p) {
+			estimate = lc
 		}
-	} else if estimate > 1.0/30.0*exp32 {
-		// Large range correction
-		estimate = -exp32 * math.Log(1-estimate/exp32)
 	}
+
 	return uint64(estimate)
 }
 
 // Merge another HyperLogLog into this one. The number of registers in
 // each must be the same.
 // Add up two hyperlogslogs, basically the UNION
+//
+// If the two sketches are using different representations (one dense,
+// one still sparse), h1 (the receiver) is promoted to dense so the
+// merge is a plain elementwise max. h2 is read via denseView and is
+// never mutated or promoted, so merging into h1 never costs h2 its
+// sparse representation.
 func (h1 *HyperLogLog) Merge(h2 *HyperLogLog) error {
 	if h1.m != h2.m {
 		return fmt.Errorf("number of registers doesn't match: %d != %d",
 			h1.m, h2.m)
 	}
-	for j, r := range h2.registers {
+
+	if h1.rep == repSparse && h2.rep == repSparse {
+		h1.mergeSparse(h2)
+		return nil
+	}
+
+	h1.toDense()
+	for j, r := range h2.denseView() {
 		if r > h1.registers[j] {
 			h1.registers[j] = r
 		}
@@ -189,37 +364,11 @@ func (h1 *HyperLogLog) Merge(h2 *HyperLogLog) error {
 	return nil
 }
 
-// Calculate the intersect count (overlap)
-// effectively doing |A UNION B| = |A| + |B| - |A INTERSECT B|
+// Calculate the intersect count (overlap) of h1 and h2, i.e.
+// |A UNION B| = |A| + |B| - |A INTERSECT B|.
+//
+// This is IntersectN specialized to two sketches; for more than two,
+// use IntersectN directly.
 func (h1 *HyperLogLog) Intersect(h2 *HyperLogLog) (uint64, error) {
-	if h1.m != h2.m {
-		return 0, fmt.Errorf("number of registers doesn't match: %d != %d",
-			h1.m, h2.m)
-	}
-
-	// Merged, union of the two inputs
-	merged, mergeErr := New(h1.m)
-	if mergeErr != nil {
-		return 0, mergeErr
-	}
-
-	// Merge inputs
-	merged.Merge(h1)
-	merged.Merge(h2)
-
-	// Union count
-	unionCount := merged.Count()
-
-	// Cumulative count
-	cumulativeCount := h1.Count() + h2.Count()
-
-	// Integer overflow (as it is all estimates)
-	if unionCount > cumulativeCount {
-		return 0, nil
-	}
-
-	// Intersect
-	intersectCount := cumulativeCount - unionCount
-
-	return intersectCount, nil
+	return h1.IntersectN(h2)
 }
@@ -0,0 +1,73 @@
+package hyperloglog
+
+import "testing"
+
+// splitmix64 is a small, well-mixed hash used only so the tests below
+// exercise realistic register indices/rho values; Add64 itself is
+// agnostic to where the 64 bits come from.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func TestSparsePromotesToDenseOnceLargerThanDense(t *testing.T) {
+	h, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 50000; i++ {
+		h.Add64(splitmix64(i))
+	}
+	if h.rep != repDense {
+		t.Fatalf("expected sketch to have promoted to dense after 50000 distinct adds, got rep=%v", h.rep)
+	}
+
+	got, want := h.Count(), uint64(50000)
+	if d := absDiff(got, want); float64(d)/float64(want) > 0.05 {
+		t.Errorf("Count() = %d, want within 5%% of %d", got, want)
+	}
+}
+
+func TestMergeDoesNotMutateOperand(t *testing.T) {
+	a, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 100; i++ {
+		a.Add64(splitmix64(i))
+		b.Add64(splitmix64(i + 1000))
+	}
+	if b.rep != repSparse {
+		t.Fatalf("expected b to still be sparse before merge, got rep=%v", b.rep)
+	}
+
+	bBefore := b.Count()
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.rep != repSparse {
+		t.Errorf("Merge must not promote its argument to dense; b.rep = %v", b.rep)
+	}
+	if got := b.Count(); got != bBefore {
+		t.Errorf("b.Count() changed from %d to %d after being merged into a", bBefore, got)
+	}
+
+	got, want := a.Count(), uint64(200)
+	if d := absDiff(got, want); float64(d)/float64(want) > 0.2 {
+		t.Errorf("a.Count() after merge = %d, want within 20%% of %d", got, want)
+	}
+}
+
+func absDiff(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,105 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// MaxIntersectN bounds how many sketches IntersectN (and the
+// Jaccard/Similarity helpers built on it) will combine via
+// inclusion-exclusion. Each additional sketch doubles the number of
+// subset unions that have to be estimated, and inclusion-exclusion
+// sums those estimates with alternating sign -- so estimator error
+// that would be negligible for a single Count compounds quickly as N
+// grows. Treat anything above 3 or so sketches with suspicion; 4 is a
+// conservative default, and callers that understand the tradeoff can
+// raise it.
+var MaxIntersectN = 4
+
+// IntersectN estimates the cardinality of the intersection of h1 and
+// hs via the inclusion-exclusion principle: for every non-empty
+// subset S of {h1, hs...}, it estimates |union of S| and sums those
+// estimates with sign (-1)^(|S|+1). A negative total (possible since
+// every term is itself an estimate) is clamped to zero.
+//
+// The number of sketches combined (1+len(hs)) must not exceed
+// MaxIntersectN, or IntersectN returns an error -- see MaxIntersectN's
+// doc comment for why.
+func (h1 *HyperLogLog) IntersectN(hs ...*HyperLogLog) (uint64, error) {
+	all := append([]*HyperLogLog{h1}, hs...)
+	n := len(all)
+	if n > MaxIntersectN {
+		return 0, fmt.Errorf("hyperloglog: IntersectN supports at most %d sketches (got %d); raise MaxIntersectN if you understand the error amplification involved", MaxIntersectN, n)
+	}
+	for _, h := range all[1:] {
+		if h.m != h1.m {
+			return 0, fmt.Errorf("number of registers doesn't match: %d != %d", h1.m, h.m)
+		}
+	}
+
+	var total float64
+	for mask := 1; mask < (1 << uint(n)); mask++ {
+		union, err := unionCount(all, mask)
+		if err != nil {
+			return 0, err
+		}
+		if bits.OnesCount(uint(mask))%2 == 1 {
+			total += union
+		} else {
+			total -= union
+		}
+	}
+	if total < 0 {
+		total = 0
+	}
+	return uint64(total), nil
+}
+
+// unionCount estimates |union of sketches selected by mask| by
+// merging them into a fresh sketch and reading Count.
+func unionCount(all []*HyperLogLog, mask int) (float64, error) {
+	// New rather than NewPlus: all we need is a dense scratch sketch
+	// with the right m to merge into, and NewPlus would also enforce
+	// the [minPrecision, maxPrecision] range that NewPlus-built sketches
+	// live in -- but Intersect/IntersectN predate NewPlus and are built
+	// on plain New, which only requires a power of two m. Using NewPlus
+	// here would make Intersect reject sketch pairs (e.g. New(8)) that
+	// worked before this package grew HLL++ support.
+	merged, err := New(all[0].m)
+	if err != nil {
+		return 0, err
+	}
+	for i, h := range all {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		if err := merged.Merge(h); err != nil {
+			return 0, err
+		}
+	}
+	return float64(merged.Count()), nil
+}
+
+// Jaccard estimates the Jaccard index |A∩B| / |A∪B| between h1 and
+// h2.
+func (h1 *HyperLogLog) Jaccard(h2 *HyperLogLog) (float64, error) {
+	return h1.Similarity(h2)
+}
+
+// Similarity generalizes Jaccard to N sketches: |intersection of all
+// of them| / |union of all of them|, with the intersection estimated
+// via IntersectN and therefore subject to the same MaxIntersectN cap.
+func (h1 *HyperLogLog) Similarity(hs ...*HyperLogLog) (float64, error) {
+	inter, err := h1.IntersectN(hs...)
+	if err != nil {
+		return 0, err
+	}
+	union, err := unionCount(append([]*HyperLogLog{h1}, hs...), (1<<uint(1+len(hs)))-1)
+	if err != nil {
+		return 0, err
+	}
+	if union == 0 {
+		return 0, nil
+	}
+	return float64(inter) / union, nil
+}
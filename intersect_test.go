@@ -0,0 +1,97 @@
+package hyperloglog
+
+import "testing"
+
+func TestIntersectNAndJaccard(t *testing.T) {
+	a, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a = {0..99999}, b = {50000..149999}: true |a∩b| = 50000,
+	// true |a∪b| = 150000, true Jaccard = 50000/150000 = 1/3.
+	for i := uint64(0); i < 100000; i++ {
+		a.Add64(splitmix64(i))
+	}
+	for i := uint64(50000); i < 150000; i++ {
+		b.Add64(splitmix64(i))
+	}
+
+	inter, err := a.IntersectN(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := absDiff(inter, 50000); float64(d)/50000 > 0.1 {
+		t.Errorf("IntersectN(a, b) = %d, want within 10%% of 50000", inter)
+	}
+
+	jac, err := a.Jaccard(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 1.0 / 3.0
+	if diff := jac - want; diff < -0.05 || diff > 0.05 {
+		t.Errorf("Jaccard(a, b) = %f, want within 0.05 of %f", jac, want)
+	}
+}
+
+func TestJaccardOfDisjointSketchesIsNearZero(t *testing.T) {
+	a, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPlus(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 10000; i++ {
+		a.Add64(splitmix64(i))
+		b.Add64(splitmix64(i + 1_000_000))
+	}
+
+	jac, err := a.Jaccard(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jac > 0.05 {
+		t.Errorf("Jaccard of disjoint sketches = %f, want close to 0", jac)
+	}
+}
+
+func TestIntersectBelowHLLPlusPrecisionRange(t *testing.T) {
+	// New(8) is precision 3, below minPrecision (4) -- never valid for
+	// NewPlus, but always valid for New, and Intersect must keep
+	// working for it.
+	a, err := New(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Add64(1)
+	b.Add64(1)
+
+	if _, err := a.Intersect(b); err != nil {
+		t.Fatalf("Intersect on two New(8) sketches returned an error: %v", err)
+	}
+}
+
+func TestIntersectNRejectsTooManySketches(t *testing.T) {
+	orig := MaxIntersectN
+	MaxIntersectN = 2
+	defer func() { MaxIntersectN = orig }()
+
+	a, _ := NewPlus(10)
+	b, _ := NewPlus(10)
+	c, _ := NewPlus(10)
+
+	if _, err := a.IntersectN(b, c); err == nil {
+		t.Fatal("expected an error for 3 sketches with MaxIntersectN = 2, got nil")
+	}
+}
@@ -0,0 +1,142 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"hash/fnv"
+	"reflect"
+)
+
+// Hash ids known to Sketch's binary format. hashUnknown marks a hash
+// set via SetHash that wasn't built by one of the registered
+// factories; a Sketch decoded with that id falls back to the default
+// hash, since there's no way to recover the caller's original choice
+// from the wire bytes alone.
+const (
+	hashFNV64a uint8 = iota
+	hashCRC64ISO
+	hashUnknown uint8 = 0xff
+)
+
+// HashFactory constructs a fresh hash.Hash64. Sketch stores the id of
+// whichever factory produced its hash (not the hash's running state),
+// so a sketch decoded from MarshalBinary keeps hashing new
+// observations the same way as the one that produced the bytes.
+type HashFactory func() hash.Hash64
+
+var hashRegistry = map[uint8]HashFactory{
+	hashFNV64a:   func() hash.Hash64 { return fnv.New64a() },
+	hashCRC64ISO: func() hash.Hash64 { return crc64.New(crc64.MakeTable(crc64.ISO)) },
+}
+
+// RegisterHash makes a custom hash.Hash64 factory available under id,
+// so Sketches built with it keep round-tripping through
+// MarshalBinary/UnmarshalBinary. Built-in ids 0 and 1 are reserved.
+func RegisterHash(id uint8, factory HashFactory) {
+	hashRegistry[id] = factory
+}
+
+// Sketch wraps a HyperLogLog with a configurable hash.Hash64 so
+// callers can feed it raw observations -- bytes, strings, or an
+// io.Writer stream -- instead of hashing them first. This mirrors the
+// streaming cardinality estimators in packages like gonum's
+// stat/card: point Sketch at a stream and read back a running
+// distinct count.
+type Sketch struct {
+	*HyperLogLog
+
+	hashID uint8
+	h      hash.Hash64
+}
+
+// NewSketch returns a Sketch with 2^precision registers (see NewPlus)
+// and the default hash, FNV-1a/64 from the standard library. Use
+// SetHash to switch to a better-distributed 64 bit hash such as
+// xxhash if your module already depends on one.
+func NewSketch(precision uint8) (*Sketch, error) {
+	hll, err := NewPlus(precision)
+	if err != nil {
+		return nil, err
+	}
+	return &Sketch{
+		HyperLogLog: hll,
+		hashID:      hashFNV64a,
+		h:           hashRegistry[hashFNV64a](),
+	}, nil
+}
+
+// SetHash replaces the hash used for AddBytes/AddString/Write. h is
+// used directly for subsequent observations; to be identifiable in
+// MarshalBinary, h must have been constructed by a HashFactory
+// registered (built-in or via RegisterHash) under the same type.
+func (s *Sketch) SetHash(h hash.Hash64) {
+	s.h = h
+	s.hashID = idForHash(h)
+}
+
+func idForHash(h hash.Hash64) uint8 {
+	t := reflect.TypeOf(h)
+	for id, factory := range hashRegistry {
+		if reflect.TypeOf(factory()) == t {
+			return id
+		}
+	}
+	return hashUnknown
+}
+
+// AddBytes hashes b and adds the result to the sketch.
+func (s *Sketch) AddBytes(b []byte) {
+	s.h.Reset()
+	s.h.Write(b)
+	s.HyperLogLog.Add64(s.h.Sum64())
+}
+
+// AddString hashes s and adds the result to the sketch.
+func (s *Sketch) AddString(str string) {
+	s.AddBytes([]byte(str))
+}
+
+// Write implements io.Writer, treating each call as one observation.
+// It never returns an error; n is always len(p).
+func (s *Sketch) Write(p []byte) (int, error) {
+	s.AddBytes(p)
+	return len(p), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It extends
+// HyperLogLog's format with a leading hash id byte, so UnmarshalBinary
+// can restore the same hash for subsequent AddBytes/AddString calls.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	body, err := s.HyperLogLog.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(body)+1)
+	out = append(out, s.hashID)
+	out = append(out, body...)
+	return out, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("hyperloglog: sketch binary payload too short (%d bytes)", len(data))
+	}
+	hashID, body := data[0], data[1:]
+
+	if s.HyperLogLog == nil {
+		s.HyperLogLog = &HyperLogLog{}
+	}
+	if err := s.HyperLogLog.UnmarshalBinary(body); err != nil {
+		return err
+	}
+
+	factory, ok := hashRegistry[hashID]
+	if !ok {
+		hashID, factory = hashFNV64a, hashRegistry[hashFNV64a]
+	}
+	s.hashID = hashID
+	s.h = factory()
+	return nil
+}
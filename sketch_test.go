@@ -0,0 +1,88 @@
+package hyperloglog
+
+import (
+	"hash"
+	"hash/crc64"
+	"testing"
+)
+
+func TestSketchHashIDRoundTrip(t *testing.T) {
+	s, err := NewSketch(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetHash(crc64.New(crc64.MakeTable(crc64.ISO)))
+	s.AddString("hello")
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := &Sketch{}
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if s2.hashID != hashCRC64ISO {
+		t.Errorf("hashID after round-trip = %d, want %d (hashCRC64ISO)", s2.hashID, hashCRC64ISO)
+	}
+}
+
+// customHash64 is never registered via RegisterHash, so a Sketch using
+// it should fall back to hashUnknown/the default hash on round-trip.
+type customHash64 struct{ hash.Hash64 }
+
+func TestSketchUnregisteredHashFallsBackToDefault(t *testing.T) {
+	s, err := NewSketch(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetHash(customHash64{fnv64aForTest()})
+	if s.hashID != hashUnknown {
+		t.Fatalf("hashID for an unregistered hash = %d, want hashUnknown", s.hashID)
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := &Sketch{}
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if s2.hashID != hashFNV64a {
+		t.Errorf("hashID after round-tripping an unregistered hash = %d, want hashFNV64a (the fallback)", s2.hashID)
+	}
+}
+
+func fnv64aForTest() hash.Hash64 {
+	return hashRegistry[hashFNV64a]()
+}
+
+func TestSketchWriteIsOneObservation(t *testing.T) {
+	s, err := NewSketch(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Write([]byte("some bytes"))
+	if err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if n != len("some bytes") {
+		t.Errorf("Write returned n = %d, want %d", n, len("some bytes"))
+	}
+	if got, want := s.Count(), uint64(1); got != want {
+		t.Errorf("Count after one Write = %d, want %d", got, want)
+	}
+
+	// Writing the same bytes again is a repeat of the same observation,
+	// not two more bytes appended to a stream -- Count should stay put.
+	if _, err := s.Write([]byte("some bytes")); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if got, want := s.Count(), uint64(1); got != want {
+		t.Errorf("Count after repeating the same Write = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,189 @@
+package hyperloglog
+
+import (
+	"math"
+	"sort"
+)
+
+// sparseTmpSetMax bounds how many observations accumulate in tmpSet
+// before they are folded into the sorted sparseList. A bigger buffer
+// means cheaper adds (append-only) but a more expensive, less
+// frequent merge.
+const sparseTmpSetMax = 256
+
+// encodeSparse packs a register index and its rho value into a single
+// uint32 so the sparse list can be a plain sortable slice instead of a
+// slice of structs.
+func encodeSparse(idx uint32, r uint8) uint32 {
+	return idx<<8 | uint32(r)
+}
+
+func decodeSparse(v uint32) (idx uint32, r uint8) {
+	return v >> 8, uint8(v)
+}
+
+// addSparse records an observation while the sketch is still in the
+// sparse representation, buffering it in tmpSet until there's enough
+// to make a merge into sparseList worthwhile.
+func (h *HyperLogLog) addSparse(idx uint32, r uint8) {
+	h.tmpSet = append(h.tmpSet, encodeSparse(idx, r))
+	if len(h.tmpSet) >= sparseTmpSetMax {
+		h.mergeTmpSet()
+	}
+	h.maybePromote()
+}
+
+// mergeTmpSet folds the buffered observations into the sorted
+// sparseList, keeping only the maximum rho seen per register index.
+func (h *HyperLogLog) mergeTmpSet() {
+	if len(h.tmpSet) == 0 {
+		return
+	}
+
+	sort.Slice(h.tmpSet, func(i, j int) bool {
+		ii, _ := decodeSparse(h.tmpSet[i])
+		ij, _ := decodeSparse(h.tmpSet[j])
+		return ii < ij
+	})
+
+	merged := make([]uint32, 0, len(h.sparseList)+len(h.tmpSet))
+	i, j := 0, 0
+	for i < len(h.sparseList) || j < len(h.tmpSet) {
+		switch {
+		case j >= len(h.tmpSet):
+			merged = appendMax(merged, h.sparseList[i])
+			i++
+		case i >= len(h.sparseList):
+			merged = appendMax(merged, h.tmpSet[j])
+			j++
+		default:
+			ai, ar := decodeSparse(h.sparseList[i])
+			bj, br := decodeSparse(h.tmpSet[j])
+			switch {
+			case ai < bj:
+				merged = appendMax(merged, h.sparseList[i])
+				i++
+			case bj < ai:
+				merged = appendMax(merged, h.tmpSet[j])
+				j++
+			default:
+				if br > ar {
+					merged = appendMax(merged, h.tmpSet[j])
+				} else {
+					merged = appendMax(merged, h.sparseList[i])
+				}
+				i++
+				j++
+			}
+		}
+	}
+
+	h.sparseList = merged
+	h.tmpSet = h.tmpSet[:0]
+}
+
+// appendMax appends v to dst, collapsing it with the previous entry
+// when they share an index and keeping whichever has the larger rho.
+// Used by mergeTmpSet/mergeSparse, both of which walk their inputs in
+// index order but can still see the same index twice in a row.
+func appendMax(dst []uint32, v uint32) []uint32 {
+	if n := len(dst); n > 0 {
+		idx, r := decodeSparse(v)
+		pidx, pr := decodeSparse(dst[n-1])
+		if idx == pidx {
+			if r > pr {
+				dst[n-1] = v
+			}
+			return dst
+		}
+	}
+	return append(dst, v)
+}
+
+// maybePromote switches to the dense representation once the sparse
+// one would no longer be the more compact choice: each sparse entry
+// costs 4 bytes versus 1 byte per dense register.
+func (h *HyperLogLog) maybePromote() {
+	if h.rep != repSparse {
+		return
+	}
+	if uint(len(h.sparseList)+len(h.tmpSet))*4 > h.m {
+		h.toDense()
+	}
+}
+
+// toDense promotes a sparse sketch to the dense representation. It is
+// a no-op if h is already dense.
+func (h *HyperLogLog) toDense() {
+	if h.rep == repDense {
+		return
+	}
+	h.mergeTmpSet()
+
+	registers := make([]uint8, h.m)
+	for _, v := range h.sparseList {
+		idx, r := decodeSparse(v)
+		registers[idx] = r
+	}
+
+	h.registers = registers
+	h.rep = repDense
+	h.sparseList = nil
+	h.tmpSet = nil
+}
+
+// mergeSparse merges h2 into h1 while both remain sparse, promoting
+// the result to dense if it has grown too large to stay sparse.
+func (h1 *HyperLogLog) mergeSparse(h2 *HyperLogLog) {
+	h1.mergeTmpSet()
+	h2.mergeTmpSet()
+
+	merged := make([]uint32, 0, len(h1.sparseList)+len(h2.sparseList))
+	i, j := 0, 0
+	for i < len(h1.sparseList) || j < len(h2.sparseList) {
+		switch {
+		case j >= len(h2.sparseList):
+			merged = appendMax(merged, h1.sparseList[i])
+			i++
+		case i >= len(h1.sparseList):
+			merged = appendMax(merged, h2.sparseList[j])
+			j++
+		default:
+			ai, _ := decodeSparse(h1.sparseList[i])
+			bj, _ := decodeSparse(h2.sparseList[j])
+			switch {
+			case ai < bj:
+				merged = appendMax(merged, h1.sparseList[i])
+				i++
+			case bj < ai:
+				merged = appendMax(merged, h2.sparseList[j])
+				j++
+			default:
+				merged = appendMax(merged, h1.sparseList[i])
+				merged = appendMax(merged, h2.sparseList[j])
+				i++
+				j++
+			}
+		}
+	}
+
+	h1.sparseList = merged
+	h1.maybePromote()
+}
+
+// countSparse implements linear counting directly over the sparse
+// list. Linear counting is accurate for the cardinalities the sparse representation
+// is meant to cover (few enough distinct registers that dense storage
+// hasn't paid for itself yet), so no bias correction is needed here.
+func (h *HyperLogLog) countSparse() uint64 {
+	h.mergeTmpSet()
+	m := float64(h.m)
+	zeros := h.m - uint(len(h.sparseList))
+	if zeros == 0 {
+		// Every register has been touched; fall back to the dense
+		// estimator rather than dividing by zero.
+		h.toDense()
+		return h.countDense()
+	}
+	return uint64(m * math.Log(m/float64(zeros)))
+}
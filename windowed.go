@@ -0,0 +1,130 @@
+package hyperloglog
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// windowSample is one (rho, observed-at) pair kept in a register's
+// ring buffer. Buffers are kept sorted ascending by t and descending
+// by rho at the same time: see AddAt.
+type windowSample struct {
+	rho uint8
+	t   time.Time
+}
+
+// WindowedHLL estimates cardinality over a trailing time window
+// rather than forever -- "unique users in the last 5 minutes" rather
+// than "unique users ever", which a plain HyperLogLog can't answer
+// since a register's max rho, once set, never goes back down.
+//
+// Each register instead keeps a small bounded history of (rho,
+// timestamp) samples, and CountAt reads back whichever of those is
+// both still inside the window and the largest -- that register's
+// effective max rho as of that instant.
+type WindowedHLL struct {
+	m          uint
+	b          uint32
+	alpha      float64
+	window     time.Duration
+	maxSamples int
+	registers  [][]windowSample
+}
+
+// NewWindowed returns a WindowedHLL with the given number of
+// registers (same power-of-two requirement as New) tracking a trailing
+// window of the given duration. maxSamplesPerRegister bounds memory:
+// once a register's history reaches that many entries, the newest
+// (and, by construction, smallest) is dropped even if it hasn't
+// expired yet, trading a small amount of accuracy under heavy churn
+// for a hard cap on memory use -- the current max is always the
+// oldest entry and is never the one evicted for being over cap.
+func NewWindowed(registers uint, window time.Duration, maxSamplesPerRegister int) (*WindowedHLL, error) {
+	if (registers & (registers - 1)) != 0 {
+		return nil, fmt.Errorf("number of registers %d not a power of two", registers)
+	}
+	if maxSamplesPerRegister <= 0 {
+		return nil, fmt.Errorf("maxSamplesPerRegister must be positive, got %d", maxSamplesPerRegister)
+	}
+	return &WindowedHLL{
+		m:          registers,
+		b:          uint32(math.Ceil(math.Log2(float64(registers)))),
+		alpha:      get_alpha(registers),
+		window:     window,
+		maxSamples: maxSamplesPerRegister,
+		registers:  make([][]windowSample, registers),
+	}, nil
+}
+
+// AddAt records val as observed at time t. val should be a 32 bit
+// unsigned integer from a good hash function, as with HyperLogLog.Add.
+//
+// The new sample is always appended, after popping every tail entry
+// whose rho is smaller than or equal to its own: such an older entry can never again be the max
+// once a newer, at-least-as-large one exists, so it's dropped
+// immediately rather than waiting for it to expire. Samples older
+// than window are evicted from the front for the same reason.
+func (w *WindowedHLL) AddAt(val uint32, t time.Time) {
+	k := 32 - w.b
+	r := rho(val<<w.b, k)
+	j := val >> uint(k)
+
+	buf := w.registers[j]
+	cutoff := t.Add(-w.window)
+	for len(buf) > 0 && buf[0].t.Before(cutoff) {
+		buf = buf[1:]
+	}
+	for len(buf) > 0 && buf[len(buf)-1].rho <= r {
+		buf = buf[:len(buf)-1]
+	}
+	buf = append(buf, windowSample{rho: r, t: t})
+	if len(buf) > w.maxSamples {
+		// buf is sorted ascending by time and descending by rho, so
+		// buf[0] holds the current max; trim from the back (the
+		// newest, smallest-rho entries) rather than the front, or
+		// CountAt would lose the max the instant the cap is hit.
+		buf = buf[:w.maxSamples]
+	}
+	w.registers[j] = buf
+}
+
+// CountAt estimates the cardinality of the distinct values whose
+// samples are no older than t-window (a sample at exactly t-window
+// still counts); samples timestamped after t are not excluded. It uses the same bias-corrected estimator as
+// HyperLogLog.Count, just fed each register's current-as-of-t max rho
+// instead of an unconditional one.
+func (w *WindowedHLL) CountAt(t time.Time) uint64 {
+	sum := 0.0
+	zeros := 0
+	m := float64(w.m)
+	cutoff := t.Add(-w.window)
+
+	for j, buf := range w.registers {
+		for len(buf) > 0 && buf[0].t.Before(cutoff) {
+			buf = buf[1:]
+		}
+		w.registers[j] = buf
+
+		var r uint8
+		if len(buf) > 0 {
+			r = buf[0].rho
+		}
+		sum += pow2inv[r]
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := w.alpha * m * m / sum
+	if estimate <= 5.0*m {
+		estimate -= estimateBias(estimate, uint8(w.b))
+	}
+	if zeros != 0 {
+		lc := m * math.Log(m/float64(zeros))
+		if lc <= biasThreshold(uint8(w.b)) {
+			estimate = lc
+		}
+	}
+	return uint64(estimate)
+}
@@ -0,0 +1,72 @@
+package hyperloglog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowedCountsOnlyWithinWindow(t *testing.T) {
+	w, err := NewWindowed(16384, 5*time.Minute, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now()
+	for i := uint64(0); i < 50000; i++ {
+		w.AddAt(uint32(splitmix64(i)), base.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	got := w.CountAt(base.Add(60 * time.Second))
+	if d := absDiff(got, 50000); float64(d)/50000 > 0.1 {
+		t.Errorf("CountAt(within window) = %d, want within 10%% of 50000", got)
+	}
+
+	afterWindow := base.Add(10 * time.Minute)
+	if got := w.CountAt(afterWindow); got > 200 {
+		t.Errorf("CountAt(after every sample expired) = %d, want close to 0", got)
+	}
+
+	for i := uint64(0); i < 1000; i++ {
+		w.AddAt(uint32(splitmix64(i+1_000_000)), afterWindow)
+	}
+	got = w.CountAt(afterWindow)
+	if d := absDiff(got, 1000); float64(d)/1000 > 0.2 {
+		t.Errorf("CountAt after fresh adds = %d, want within 20%% of 1000", got)
+	}
+}
+
+// TestWindowedCapKeepsTheMax is a white-box test for the
+// maxSamplesPerRegister eviction: a single register's ring buffer is
+// sorted ascending by time and descending by rho, so buf[0] is always
+// the current max and must never be the entry evicted when the cap is
+// hit. Feeding one register a strictly-decreasing-rho sequence builds
+// a multi-entry buffer (each new, smaller-rho sample doesn't collapse
+// any earlier, larger-rho one), so once the cap is exceeded we can
+// check directly that the buffer stayed at the cap and the max
+// (buf[0]) survived.
+func TestWindowedCapKeepsTheMax(t *testing.T) {
+	w, err := NewWindowed(2, time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now()
+
+	// index 0, rho: 32 (val=0, the maximum for k=31... see rho's
+	// loop), then 5, 4, 3, 2, 1 -- strictly decreasing, so every one
+	// of these is appended rather than collapsing a predecessor.
+	vals := []uint32{0, 1 << 26, 1 << 27, 1 << 28, 1 << 29, 1 << 30}
+	for i, v := range vals {
+		w.AddAt(v, base.Add(time.Duration(i)*time.Second))
+	}
+
+	buf := w.registers[0]
+	if len(buf) != w.maxSamples {
+		t.Fatalf("buffer len = %d, want it capped at maxSamples = %d", len(buf), w.maxSamples)
+	}
+	if buf[0].rho < buf[len(buf)-1].rho {
+		t.Fatalf("buffer should stay sorted descending by rho front-to-back, got %+v", buf)
+	}
+	const maxPossibleRho = 32
+	if buf[0].rho != maxPossibleRho {
+		t.Errorf("buf[0].rho = %d, want %d (the running max); the cap must have evicted it", buf[0].rho, maxPossibleRho)
+	}
+}